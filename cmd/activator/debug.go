@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/profiling"
+)
+
+// debugPath is the path on the profiling port the activator state is served at.
+const debugPath = "/debug/activator"
+
+// debugHandler serves the activator state. Like the pprof endpoints it sits
+// next to, it is only enabled when profiling is enabled in config-observability.
+// Since the state lists revisions and pod IPs across all namespaces, the
+// caller must in addition present a bearer token that the API server
+// authenticates and that is authorized to get the debugPath non-resource URL.
+type debugHandler struct {
+	enabled    *atomic.Bool
+	next       http.Handler
+	kubeClient kubernetes.Interface
+	logger     *zap.SugaredLogger
+}
+
+func newDebugHandler(logger *zap.SugaredLogger, kubeClient kubernetes.Interface, next http.Handler) *debugHandler {
+	return &debugHandler{
+		enabled:    atomic.NewBool(false),
+		next:       next,
+		kubeClient: kubeClient,
+		logger:     logger,
+	}
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled.Load() {
+		http.NotFound(w, r)
+		return
+	}
+	const bearer = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearer) || len(auth) == len(bearer) {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	token := auth[len(bearer):]
+	user, ok := h.authenticate(r, token)
+	if !ok {
+		http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+	if !h.authorize(r, user) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// authenticate validates the token with a TokenReview and returns the user
+// it belongs to.
+func (h *debugHandler) authenticate(r *http.Request, token string) (authnv1.UserInfo, bool) {
+	review, err := h.kubeClient.AuthenticationV1().TokenReviews().Create(r.Context(),
+		&authnv1.TokenReview{Spec: authnv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		h.logger.Errorw("Failed to review the debug request token", zap.Error(err))
+		return authnv1.UserInfo{}, false
+	}
+	return review.Status.User, review.Status.Authenticated
+}
+
+// authorize checks with a SubjectAccessReview that the user may get debugPath.
+func (h *debugHandler) authorize(r *http.Request, user authnv1.UserInfo) bool {
+	extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	review, err := h.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(r.Context(),
+		&authzv1.SubjectAccessReview{Spec: authzv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authzv1.NonResourceAttributes{
+				Path: debugPath,
+				Verb: "get",
+			},
+		}}, metav1.CreateOptions{})
+	if err != nil {
+		h.logger.Errorw("Failed to review the debug request access", zap.Error(err))
+		return false
+	}
+	return review.Status.Allowed
+}
+
+// updateFromConfigMap enables or disables the handler according to the
+// profiling flag in the given ConfigMap.
+func (h *debugHandler) updateFromConfigMap(configMap *corev1.ConfigMap) {
+	enabled, err := profiling.ReadProfilingFlag(configMap.Data)
+	if err != nil {
+		h.logger.Errorw("Failed to update the debug handler flag", zap.Error(err))
+		return
+	}
+	h.enabled.Store(enabled)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+	ltesting "knative.dev/pkg/logging/testing"
+)
+
+const (
+	// The tokens understood by the fake TokenReview reactor.
+	allowedToken   = "allowed-token"
+	forbiddenToken = "forbidden-token"
+
+	allowedUser = "debugger"
+)
+
+// fakeReviewClient returns a clientset that authenticates allowedToken and
+// forbiddenToken, and only authorizes the user of allowedToken.
+func fakeReviewClient() *fakekubeclientset.Clientset {
+	kc := fakekubeclientset.NewSimpleClientset()
+	kc.PrependReactor("create", "tokenreviews", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		review := action.(clientgotesting.CreateAction).GetObject().(*authnv1.TokenReview).DeepCopy()
+		switch review.Spec.Token {
+		case allowedToken:
+			review.Status = authnv1.TokenReviewStatus{Authenticated: true, User: authnv1.UserInfo{Username: allowedUser}}
+		case forbiddenToken:
+			review.Status = authnv1.TokenReviewStatus{Authenticated: true, User: authnv1.UserInfo{Username: "someone-else"}}
+		}
+		return true, review, nil
+	})
+	kc.PrependReactor("create", "subjectaccessreviews", func(action clientgotesting.Action) (bool, runtime.Object, error) {
+		review := action.(clientgotesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview).DeepCopy()
+		attrs := review.Spec.NonResourceAttributes
+		review.Status.Allowed = review.Spec.User == allowedUser &&
+			attrs != nil && attrs.Path == debugPath && attrs.Verb == "get"
+		return true, review, nil
+	})
+	return kc
+}
+
+func TestDebugHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	enabled := map[string]string{"profiling.enable": "true"}
+
+	tests := []struct {
+		name string
+		// data are the config map contents applied, in order, to a new handler.
+		data  []map[string]string
+		token string
+		want  int
+	}{{
+		name:  "disabled by default",
+		token: allowedToken,
+		want:  http.StatusNotFound,
+	}, {
+		name:  "enabled",
+		data:  []map[string]string{enabled},
+		token: allowedToken,
+		want:  http.StatusOK,
+	}, {
+		name: "no token",
+		data: []map[string]string{enabled},
+		want: http.StatusUnauthorized,
+	}, {
+		name:  "unauthenticated token",
+		data:  []map[string]string{enabled},
+		token: "bogus-token",
+		want:  http.StatusUnauthorized,
+	}, {
+		name:  "unauthorized user",
+		data:  []map[string]string{enabled},
+		token: forbiddenToken,
+		want:  http.StatusForbidden,
+	}, {
+		name:  "invalid flag keeps previous value",
+		data:  []map[string]string{enabled, {"profiling.enable": "bogus"}},
+		token: allowedToken,
+		want:  http.StatusOK,
+	}, {
+		name:  "disabled",
+		data:  []map[string]string{enabled, {"profiling.enable": "false"}},
+		token: allowedToken,
+		want:  http.StatusNotFound,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newDebugHandler(ltesting.TestLogger(t), fakeReviewClient(), next)
+			for _, data := range test.data {
+				h.updateFromConfigMap(&corev1.ConfigMap{Data: data})
+			}
+			req := httptest.NewRequest(http.MethodGet, debugPath, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got := rec.Code; got != test.want {
+				t.Errorf("StatusCode = %d, want: %d", got, test.want)
+			}
+		})
+	}
+}
@@ -191,7 +191,7 @@ func main() {
 	}
 
 	// Start throttler.
-	throttler := activatornet.NewThrottler(ctx, env.PodIP)
+	throttler := activatornet.NewThrottler(ctx, env.PodName, env.PodIP)
 	go throttler.Run(ctx, transport, networkConfig.EnableMeshPodAddressability, networkConfig.MeshCompatibilityMode)
 
 	oct := tracing.NewOpenCensusTracer(tracing.WithExporterFull(networking.ActivatorServiceName, env.PodIP, logger))
@@ -267,6 +267,7 @@ func main() {
 	ah = &activatorhandler.HealthHandler{HealthCheck: hc, NextHandler: ah, Logger: logger}
 
 	profilingHandler := profiling.NewHandler(logger, false)
+	debugHandler := newDebugHandler(logger, kubeClient, throttler.DebugHandler())
 	// Watch the logging config map and dynamically update logging levels.
 	configMapWatcher.Watch(pkglogging.ConfigMapName(), pkglogging.UpdateLevelFromConfigMap(logger, atomicLevel, component))
 
@@ -274,16 +275,21 @@ func main() {
 	configMapWatcher.Watch(metrics.ConfigMapName(),
 		metrics.ConfigMapWatcher(ctx, component, nil /* SecretFetcher */, logger),
 		updateRequestLogFromConfigMap(logger, reqLogHandler),
-		profilingHandler.UpdateFromConfigMap)
+		profilingHandler.UpdateFromConfigMap,
+		debugHandler.updateFromConfigMap)
 
 	if err = configMapWatcher.Start(ctx.Done()); err != nil {
 		logger.Fatalw("Failed to start configuration manager", zap.Error(err))
 	}
 
+	profilingMux := http.NewServeMux()
+	profilingMux.Handle("/", profilingHandler)
+	profilingMux.Handle(debugPath, debugHandler)
+
 	servers := map[string]*http.Server{
 		"http1":   pkgnet.NewServer(":"+strconv.Itoa(networking.BackendHTTPPort), ah),
 		"h2c":     pkgnet.NewServer(":"+strconv.Itoa(networking.BackendHTTP2Port), ah),
-		"profile": profiling.NewServer(profilingHandler),
+		"profile": profiling.NewServer(profilingMux),
 	}
 
 	errCh := make(chan error, len(servers))
@@ -61,9 +61,8 @@ func (h *contextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// If the headers aren't explicitly specified, then decode the revision
 	// name and namespace from the Host header.
 	if name == "" || namespace == "" {
-		parts := strings.SplitN(r.Host, ".", 4)
-		if len(parts) == 4 && parts[2] == "svc" && strings.SplitN(parts[3], ":", 2)[0] == network.GetClusterDomainName() {
-			name, namespace = parts[0], parts[1]
+		if n, ns, ok := revisionFromHost(r.Host); ok {
+			name, namespace = n, ns
 		}
 	}
 
@@ -82,6 +81,17 @@ func (h *contextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.nextHandler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// revisionFromHost decodes the revision name and namespace from a host of
+// the form {name}.{namespace}.svc.{cluster-domain}, optionally with a port.
+// Both name and namespace must be non-empty.
+func revisionFromHost(host string) (name, namespace string, ok bool) {
+	parts := strings.SplitN(host, ".", 4)
+	if len(parts) == 4 && parts[0] != "" && parts[1] != "" && parts[2] == "svc" && strings.SplitN(parts[3], ":", 2)[0] == network.GetClusterDomainName() {
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
 func sendError(err error, w http.ResponseWriter) {
 	msg := fmt.Sprint("Error getting active endpoint: ", err)
 	if k8serrors.IsNotFound(err) {
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -110,6 +111,83 @@ func TestContextHandlerError(t *testing.T) {
 	}
 }
 
+func TestRevisionFromHost(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		wantName      string
+		wantNamespace string
+		wantOK        bool
+	}{{
+		name:          "service hostname",
+		host:          network.GetServiceHostname(testRevName, testNamespace),
+		wantName:      testRevName,
+		wantNamespace: testNamespace,
+		wantOK:        true,
+	}, {
+		name:          "service hostname with port",
+		host:          network.GetServiceHostname(testRevName, testNamespace) + ":8012",
+		wantName:      testRevName,
+		wantNamespace: testNamespace,
+		wantOK:        true,
+	}, {
+		name: "not a service hostname",
+		host: "example.com",
+	}, {
+		name: "not a svc hostname",
+		host: testRevName + "." + testNamespace + ".pod." + network.GetClusterDomainName(),
+	}, {
+		name: "other cluster domain",
+		host: testRevName + "." + testNamespace + ".svc.example.com",
+	}, {
+		name: "empty name and namespace",
+		host: "..svc." + network.GetClusterDomainName(),
+	}, {
+		name: "empty",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, namespace, ok := revisionFromHost(test.host)
+			if name != test.wantName || namespace != test.wantNamespace || ok != test.wantOK {
+				t.Errorf("revisionFromHost(%q) = (%q, %q, %v), want (%q, %q, %v)", test.host,
+					name, namespace, ok, test.wantName, test.wantNamespace, test.wantOK)
+			}
+		})
+	}
+}
+
+func FuzzRevisionFromHost(f *testing.F) {
+	for _, host := range []string{
+		network.GetServiceHostname(testRevName, testNamespace),
+		network.GetServiceHostname(testRevName, testNamespace) + ":8012",
+		"..svc." + network.GetClusterDomainName(),
+		"example.com",
+		"",
+	} {
+		f.Add(host)
+	}
+
+	f.Fuzz(func(t *testing.T, host string) {
+		name, namespace, ok := revisionFromHost(host)
+		if !ok {
+			if name != "" || namespace != "" {
+				t.Errorf("revisionFromHost(%q) = (%q, %q, false), want empty name and namespace", host, name, namespace)
+			}
+			return
+		}
+		if name == "" || namespace == "" {
+			t.Errorf("revisionFromHost(%q) = (%q, %q, true), want non-empty name and namespace", host, name, namespace)
+		}
+		if strings.Contains(name, ".") || strings.Contains(namespace, ".") {
+			t.Errorf("revisionFromHost(%q) = (%q, %q), want no dots in name or namespace", host, name, namespace)
+		}
+		if prefix := name + "." + namespace + ".svc." + network.GetClusterDomainName(); !strings.HasPrefix(host, prefix) {
+			t.Errorf("revisionFromHost(%q) = (%q, %q), want host to start with %q", host, name, namespace, prefix)
+		}
+	})
+}
+
 func BenchmarkContextHandler(b *testing.B) {
 	tests := []struct {
 		label        string
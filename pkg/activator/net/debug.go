@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the debug view of the Throttler state.
+
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// podTrackerState is a point in time view of a podTracker.
+type podTrackerState struct {
+	Dest     string `json:"dest"`
+	Capacity int    `json:"capacity"`
+	Weight   int32  `json:"weight"`
+}
+
+// revisionThrottlerState is a point in time view of a revisionThrottler.
+type revisionThrottlerState struct {
+	ContainerConcurrency int               `json:"containerConcurrency"`
+	Capacity             int               `json:"capacity"`
+	ActivatorIndex       int32             `json:"activatorIndex"`
+	NumActivators        int32             `json:"numActivators"`
+	ClusterIPDest        string            `json:"clusterIPDest,omitempty"`
+	PodTrackers          []podTrackerState `json:"podTrackers"`
+	AssignedTrackers     []podTrackerState `json:"assignedTrackers"`
+}
+
+func (p *podTracker) state() podTrackerState {
+	return podTrackerState{
+		Dest:     p.dest,
+		Capacity: p.Capacity(),
+		Weight:   p.getWeight(),
+	}
+}
+
+// state returns the current state of the throttler. Only the fields that are
+// read on the request path are reported, since the rest is owned by the
+// update goroutine and is not safe to read concurrently.
+func (rt *revisionThrottler) state() revisionThrottlerState {
+	s := rt.snapshot()
+	ret := revisionThrottlerState{
+		ContainerConcurrency: rt.containerConcurrency,
+		Capacity:             rt.breaker.Capacity(),
+		ActivatorIndex:       rt.activatorIndex.Load(),
+		NumActivators:        rt.numActivators.Load(),
+		PodTrackers:          make([]podTrackerState, 0, len(s.podTrackers)),
+		AssignedTrackers:     make([]podTrackerState, 0, len(s.assignedTrackers)),
+	}
+	if s.clusterIPTracker != nil {
+		ret.ClusterIPDest = s.clusterIPTracker.dest
+	}
+	for _, t := range s.podTrackers {
+		ret.PodTrackers = append(ret.PodTrackers, t.state())
+	}
+	for _, t := range s.assignedTrackers {
+		ret.AssignedTrackers = append(ret.AssignedTrackers, t.state())
+	}
+	return ret
+}
+
+// state returns the state of all the revision throttlers keyed by revision.
+func (t *Throttler) state() map[string]revisionThrottlerState {
+	t.revisionThrottlersMutex.RLock()
+	defer t.revisionThrottlersMutex.RUnlock()
+
+	ret := make(map[string]revisionThrottlerState, len(t.revisionThrottlers))
+	for revID, rt := range t.revisionThrottlers {
+		ret[revID.String()] = rt.state()
+	}
+	return ret
+}
+
+// DebugHandler returns a handler that serves the current state of the
+// Throttler as JSON: per revision capacity, activator assignment, all the
+// pod trackers and the ones assigned to this activator.
+func (t *Throttler) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(t.state()); err != nil {
+			t.logger.Errorw("Failed to encode the throttler state", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	pkgnet "knative.dev/networking/pkg/apis/networking"
+	. "knative.dev/pkg/logging/testing"
+	rtesting "knative.dev/pkg/reconciler/testing"
+)
+
+func TestThrottlerDebugHandler(t *testing.T) {
+	logger := TestLogger(t)
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	throttler := newTestThrottler(ctx)
+
+	podRev := types.NamespacedName{Namespace: testNamespace, Name: "pods"}
+	rt := newRevisionThrottler(podRev, 10 /*cc*/, pkgnet.ServicePortNameHTTP1, testBreakerParams, logger)
+	rt.numActivators.Store(2)
+	rt.activatorIndex.Store(0)
+	throttler.revisionThrottlers[podRev] = rt
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:   podRev,
+		Dests: sets.NewString("ip3", "ip2", "ip1"),
+	})
+
+	clusterIPRev := types.NamespacedName{Namespace: testNamespace, Name: "cluster-ip"}
+	throttler.revisionThrottlers[clusterIPRev] = newRevisionThrottler(clusterIPRev, 0 /*cc*/, pkgnet.ServicePortNameHTTP1, testBreakerParams, logger)
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:           clusterIPRev,
+		ClusterIPDest: "129.0.0.1:1234",
+		Dests:         sets.NewString("ip3"),
+	})
+
+	rec := httptest.NewRecorder()
+	throttler.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("StatusCode = %d, want: %d", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type = %q, want: %q", got, want)
+	}
+
+	var got map[string]revisionThrottlerState
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal("Failed to decode the throttler state:", err)
+	}
+	want := map[string]revisionThrottlerState{
+		podRev.String(): {
+			ContainerConcurrency: 10,
+			Capacity:             15,
+			ActivatorIndex:       0,
+			NumActivators:        2,
+			// ip2 is assigned to the other activator, and ip3 is shared
+			// between both, with half of its capacity each.
+			PodTrackers: []podTrackerState{
+				{Dest: "ip1", Capacity: 10},
+				{Dest: "ip2", Capacity: 10},
+				{Dest: "ip3", Capacity: 5},
+			},
+			AssignedTrackers: []podTrackerState{
+				{Dest: "ip1", Capacity: 10},
+				{Dest: "ip3", Capacity: 5},
+			},
+		},
+		clusterIPRev.String(): {
+			Capacity:         1,
+			ActivatorIndex:   -1,
+			ClusterIPDest:    "129.0.0.1:1234",
+			PodTrackers:      []podTrackerState{},
+			AssignedTrackers: []podTrackerState{},
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Error("Throttler state mismatch (-want,+got):", cmp.Diff(want, got))
+	}
+}
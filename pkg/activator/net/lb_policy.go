@@ -21,33 +21,35 @@ package net
 import (
 	"context"
 	"math/rand"
-	"sync"
+
+	"go.uber.org/atomic"
 )
 
 // lbPolicy is a functor that selects a target pod from the list, or (noop, nil) if
-// no such target can be currently acquired.
-// Policies will presume that `targets` list is appropriately guarded by the caller,
+// no such target can be currently acquired. It also returns the reason the
+// target was picked, which is lbReasonNoCapacity when there is none.
+// Policies will presume that `targets` list is an immutable snapshot,
 // that is while podTrackers themselves can change during this call, the list
 // and pointers therein are immutable.
-type lbPolicy func(ctx context.Context, targets []*podTracker) (func(), *podTracker)
+type lbPolicy func(ctx context.Context, targets []*podTracker) (func(), *podTracker, lbReason)
 
 // randomLBPolicy is a load balancer policy that picks a random target.
 // This approximates the LB policy done by K8s Service (IPTables based).
 //
 // nolint // This is currently unused but kept here for posterity.
-func randomLBPolicy(_ context.Context, targets []*podTracker) (func(), *podTracker) {
-	return noop, targets[rand.Intn(len(targets))]
+func randomLBPolicy(_ context.Context, targets []*podTracker) (func(), *podTracker, lbReason) {
+	return noop, targets[rand.Intn(len(targets))], lbReasonRandom
 }
 
 // randomChoice2Policy implements the Power of 2 choices LB algorithm
-func randomChoice2Policy(_ context.Context, targets []*podTracker) (func(), *podTracker) {
+func randomChoice2Policy(_ context.Context, targets []*podTracker) (func(), *podTracker, lbReason) {
 	// Avoid random if possible.
 	l := len(targets)
 	// One tracker = no choice.
 	if l == 1 {
 		pick := targets[0]
 		pick.increaseWeight()
-		return pick.decreaseWeight, pick
+		return pick.decreaseWeight, pick, lbReasonRandomChoice2
 	}
 	r1, r2 := 0, 1
 	// Two trackers - we know both contestants,
@@ -69,45 +71,58 @@ func randomChoice2Policy(_ context.Context, targets []*podTracker) (func(), *pod
 		pick = alt
 	}
 	pick.increaseWeight()
-	return pick.decreaseWeight, pick
+	return pick.decreaseWeight, pick, lbReasonRandomChoice2
 }
 
 // firstAvailableLBPolicy is a load balancer policy, that picks the first target
 // that has capacity to serve the request right now.
-func firstAvailableLBPolicy(ctx context.Context, targets []*podTracker) (func(), *podTracker) {
-	for _, t := range targets {
+func firstAvailableLBPolicy(ctx context.Context, targets []*podTracker) (func(), *podTracker, lbReason) {
+	for i, t := range targets {
 		if cb, ok := t.Reserve(ctx); ok {
-			return cb, t
+			if i > 0 {
+				return cb, t, lbReasonFirstAvailableOverflow
+			}
+			return cb, t, lbReasonFirstAvailable
 		}
 	}
-	return noop, nil
+	return noop, nil, lbReasonNoCapacity
 }
 
+// newRoundRobinPolicy returns a policy that cycles through the targets.
+// Every call atomically claims the next start index, so concurrent requests
+// begin at different targets and only move on past their start target if it
+// has no capacity left.
 func newRoundRobinPolicy() lbPolicy {
-	var (
-		mu  sync.Mutex
-		idx int
-	)
-	return func(ctx context.Context, targets []*podTracker) (func(), *podTracker) {
-		mu.Lock()
-		defer mu.Unlock()
-		// The number of trackers might have shrunk, so reset to 0.
+	return newRoundRobinPolicyAt(0)
+}
+
+// newRoundRobinPolicyAt returns a round robin policy whose first call claims
+// the start index `first`.
+func newRoundRobinPolicyAt(first uint32) lbPolicy {
+	idx := atomic.NewUint32(first)
+	return func(ctx context.Context, targets []*podTracker) (func(), *podTracker, lbReason) {
+		// The number of trackers might have shrunk, so wrap around the
+		// current length.
 		l := len(targets)
-		if idx >= l {
-			idx = 0
+		if l == 0 {
+			return noop, nil, lbReasonNoCapacity
 		}
+		// Take the modulo before converting, so that the start index stays
+		// in range when the counter wraps on 32 bit platforms.
+		start := int((idx.Inc() - 1) % uint32(l))
 
 		// Now for |targets| elements and check every next one in
 		// round robin fashion.
 		for i := 0; i < l; i++ {
-			p := (idx + i) % l
+			p := (start + i) % l
 			if cb, ok := targets[p].Reserve(ctx); ok {
-				// We want to start with the next index.
-				idx = p + 1
-				return cb, targets[p]
+				if p != start {
+					return cb, targets[p], lbReasonRoundRobinOverflow
+				}
+				return cb, targets[p], lbReasonRoundRobin
 			}
 		}
 		// We exhausted all the options...
-		return noop, nil
+		return noop, nil, lbReasonNoCapacity
 	}
 }
@@ -19,6 +19,8 @@ package net
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,7 +30,7 @@ import (
 func TestRandomChoice2(t *testing.T) {
 	t.Run("1 tracker", func(t *testing.T) {
 		podTrackers := makeTrackers(1, 0)
-		cb, pt := randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ := randomChoice2Policy(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt.dest, podTrackers[0].dest; got != want {
 			t.Errorf("pt.dest = %s, want: %s", got, want)
@@ -37,7 +39,7 @@ func TestRandomChoice2(t *testing.T) {
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
-		cb, pt = randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ = randomChoice2Policy(context.Background(), podTrackers)
 		if got, want := pt.dest, podTrackers[0].dest; got != want {
 			t.Errorf("pt.dest = %s, want: %s", got, want)
 		}
@@ -51,21 +53,21 @@ func TestRandomChoice2(t *testing.T) {
 	})
 	t.Run("2 trackers", func(t *testing.T) {
 		podTrackers := makeTrackers(2, 0)
-		cb, pt := randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ := randomChoice2Policy(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		wantW := int32(1) // to avoid casting on every check.
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
 		// Must return a different one.
-		cb, pt = randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ = randomChoice2Policy(context.Background(), podTrackers)
 		dest := pt.dest
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
 		cb()
 		// Should return the same one.
-		_, pt = randomChoice2Policy(context.Background(), podTrackers)
+		_, pt, _ = randomChoice2Policy(context.Background(), podTrackers)
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
@@ -75,20 +77,20 @@ func TestRandomChoice2(t *testing.T) {
 	})
 	t.Run("3 trackers", func(t *testing.T) {
 		podTrackers := makeTrackers(3, 0)
-		cb, pt := randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ := randomChoice2Policy(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		wantW := int32(1) // to avoid casting on every check.
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
 		// Must return a different one.
-		cb, pt = randomChoice2Policy(context.Background(), podTrackers)
+		cb, pt, _ = randomChoice2Policy(context.Background(), podTrackers)
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
 		cb()
 		// Should return same or the other unsued one.
-		_, pt = randomChoice2Policy(context.Background(), podTrackers)
+		_, pt, _ = randomChoice2Policy(context.Background(), podTrackers)
 		if got, want := pt.getWeight(), wantW; got != want {
 			t.Errorf("pt.weight = %d, want: %d", got, want)
 		}
@@ -107,7 +109,7 @@ func TestFirstAvailable(t *testing.T) {
 		}}
 
 		ctx := context.Background()
-		cb, tracker := firstAvailableLBPolicy(ctx, podTrackers)
+		cb, tracker, _ := firstAvailableLBPolicy(ctx, podTrackers)
 		defer cb()
 		if tracker == nil {
 			t.Fatal("Tracker was nil")
@@ -116,7 +118,7 @@ func TestFirstAvailable(t *testing.T) {
 		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
 		defer cancel()
 
-		cb, tracker = firstAvailableLBPolicy(ctx, podTrackers)
+		cb, tracker, _ = firstAvailableLBPolicy(ctx, podTrackers)
 		defer cb()
 		if tracker != nil {
 			t.Fatal("Tracker was not nil")
@@ -140,7 +142,7 @@ func TestFirstAvailable(t *testing.T) {
 		}}
 
 		ctx := context.Background()
-		cb, tracker := firstAvailableLBPolicy(ctx, podTrackers)
+		cb, tracker, _ := firstAvailableLBPolicy(ctx, podTrackers)
 		defer cb()
 		if tracker == nil {
 			t.Fatal("Tracker was nil")
@@ -148,7 +150,7 @@ func TestFirstAvailable(t *testing.T) {
 			t.Errorf("Tracker = %s, want: %s", got, want)
 		}
 
-		cb, tracker = firstAvailableLBPolicy(ctx, podTrackers)
+		cb, tracker, _ = firstAvailableLBPolicy(ctx, podTrackers)
 		defer cb()
 		if tracker == nil {
 			t.Fatal("Tracker was nil")
@@ -162,35 +164,42 @@ func TestRoundRobin(t *testing.T) {
 	t.Run("with cc=1", func(t *testing.T) {
 		rrp := newRoundRobinPolicy()
 		podTrackers := makeTrackers(3, 1)
-		cb, pt := rrp(context.Background(), podTrackers)
+		cb, pt, _ := rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[0]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[1]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
 		// This will make it use shorter array, jump over and start from 0.
 		// But it's occupied already, so will fail to acquire.
-		_, pt = rrp(context.Background(), podTrackers[:1])
+		_, pt, _ = rrp(context.Background(), podTrackers[:1])
 		if pt != nil {
 			t.Fatal("Wanted nil, got: ", pt)
 		}
 
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, reason := rrp(context.Background(), podTrackers)
 		if got, want := pt, podTrackers[2]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
-		_, pt = rrp(context.Background(), podTrackers)
+		// The claimed start index was 0, which is occupied.
+		if got, want := reason, lbReasonRoundRobinOverflow; got != want {
+			t.Fatalf("Reason = %v, want: %v", got, want)
+		}
+		_, pt, reason = rrp(context.Background(), podTrackers)
 		if pt != nil {
 			t.Fatal("Wanted nil, got: ", pt)
 		}
+		if got, want := reason, lbReasonNoCapacity; got != want {
+			t.Fatalf("Reason = %v, want: %v", got, want)
+		}
 
 		// Reset last one.
 		cb()
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		if got, want := pt, podTrackers[2]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
@@ -199,39 +208,88 @@ func TestRoundRobin(t *testing.T) {
 	t.Run("with cc=2", func(t *testing.T) {
 		rrp := newRoundRobinPolicy()
 		podTrackers := makeTrackers(3, 2)
-		cb, pt := rrp(context.Background(), podTrackers)
+		cb, pt, _ := rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[0]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[1]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
 		// This will make it use shorter array, jump over and start from 0.
-		cb, pt = rrp(context.Background(), podTrackers[:1])
+		cb, pt, _ = rrp(context.Background(), podTrackers[:1])
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[0]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[1]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[2]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
 		// Now index 0 has already 2 slots occupied, so is 1, so we should get 2 again.
-		cb, pt = rrp(context.Background(), podTrackers)
+		cb, pt, _ = rrp(context.Background(), podTrackers)
 		t.Cleanup(cb)
 		if got, want := pt, podTrackers[2]; got != want {
 			t.Fatalf("Tracker = %v, want: %v", got, want)
 		}
 	})
+	t.Run("counter wraps around", func(t *testing.T) {
+		rrp := newRoundRobinPolicyAt(math.MaxUint32 - 1)
+		podTrackers := makeTrackers(3, 0)
+		// (2^32-2)%3 = 2, (2^32-1)%3 = 0, then the counter restarts at 0.
+		for i, want := range []int{2, 0, 0, 1} {
+			cb, pt, _ := rrp(context.Background(), podTrackers)
+			cb()
+			if got, want := pt, podTrackers[want]; got != want {
+				t.Fatalf("Call %d: Tracker = %v, want: %v", i, got, want)
+			}
+		}
+	})
+	t.Run("concurrent with cc=10", func(t *testing.T) {
+		const (
+			pods     = 50
+			requests = 200
+		)
+		rrp := newRoundRobinPolicy()
+		podTrackers := makeTrackers(pods, 10)
+
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			counts = make(map[*podTracker]int, pods)
+			start  = make(chan struct{})
+		)
+		wg.Add(requests)
+		for i := 0; i < requests; i++ {
+			go func() {
+				defer wg.Done()
+				<-start
+				cb, pt, _ := rrp(context.Background(), podTrackers)
+				t.Cleanup(cb)
+				mu.Lock()
+				defer mu.Unlock()
+				counts[pt]++
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		// Every pod has room for all the requests it is handed as a start
+		// target, so they must be spread evenly.
+		for i, pt := range podTrackers {
+			if got, want := counts[pt], requests/pods; got != want {
+				t.Errorf("Reservations on tracker %d = %d, want: %d", i, got, want)
+			}
+		}
+	})
 }
 
 func BenchmarkPolicy(b *testing.B) {
@@ -255,7 +313,7 @@ func BenchmarkPolicy(b *testing.B) {
 			b.Run(fmt.Sprintf("%s-%d-trackers-sequential", test.name, n), func(b *testing.B) {
 				targets := makeTrackers(n, 0)
 				for i := 0; i < b.N; i++ {
-					cb, _ := test.policy(nil, targets)
+					cb, _, _ := test.policy(nil, targets)
 					cb()
 				}
 			})
@@ -264,7 +322,7 @@ func BenchmarkPolicy(b *testing.B) {
 				targets := makeTrackers(n, 0)
 				b.RunParallel(func(pb *testing.PB) {
 					for pb.Next() {
-						cb, _ := test.policy(nil, targets)
+						cb, _, _ := test.policy(nil, targets)
 						cb()
 					}
 				})
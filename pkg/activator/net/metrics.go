@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package net
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	pkgmetrics "knative.dev/pkg/metrics"
+	"knative.dev/serving/pkg/metrics"
+)
+
+// lbReason is the reason a load balancing decision was made, reported as the
+// value of the reasonKey tag.
+type lbReason int
+
+const (
+	lbReasonClusterIP lbReason = iota
+	lbReasonRandom
+	lbReasonRandomChoice2
+	lbReasonFirstAvailable
+	// lbReasonFirstAvailableOverflow is reported when the first target was
+	// full and a later one was picked.
+	lbReasonFirstAvailableOverflow
+	lbReasonRoundRobin
+	// lbReasonRoundRobinOverflow is reported when the target at the claimed
+	// start index was full and the policy moved on to a later one.
+	lbReasonRoundRobinOverflow
+	// lbReasonNoCapacity is reported when the policy did not find a pod with
+	// capacity, and the request had to be re-enqueued.
+	lbReasonNoCapacity
+
+	numLBReasons
+)
+
+var lbReasonNames = [numLBReasons]string{
+	lbReasonClusterIP:              "cluster-ip",
+	lbReasonRandom:                 "random",
+	lbReasonRandomChoice2:          "random-choice-2",
+	lbReasonFirstAvailable:         "first-available",
+	lbReasonFirstAvailableOverflow: "first-available-overflow",
+	lbReasonRoundRobin:             "round-robin",
+	lbReasonRoundRobinOverflow:     "round-robin-overflow",
+	lbReasonNoCapacity:             "no-capacity",
+}
+
+func (r lbReason) String() string {
+	return lbReasonNames[r]
+}
+
+var (
+	lbDecisionCountM = stats.Int64(
+		"lb_decision_count",
+		"The number of load balancing decisions made by the Activator",
+		stats.UnitDimensionless)
+
+	reasonKey = tag.MustNewKey("reason")
+)
+
+func init() {
+	register()
+}
+
+func register() {
+	if err := pkgmetrics.RegisterResourceView(
+		&view.View{
+			Description: "The number of load balancing decisions made by the Activator",
+			Measure:     lbDecisionCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{metrics.PodKey, metrics.ContainerKey, reasonKey},
+		},
+	); err != nil {
+		panic(err)
+	}
+}
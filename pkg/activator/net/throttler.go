@@ -24,6 +24,7 @@ import (
 	"sort"
 	"sync"
 
+	"go.opencensus.io/tag"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
@@ -39,11 +40,14 @@ import (
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/logging/logkey"
+	pkgmetrics "knative.dev/pkg/metrics"
 	"knative.dev/pkg/reconciler"
+	"knative.dev/serving/pkg/activator"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 	servinglisters "knative.dev/serving/pkg/client/listers/serving/v1"
+	"knative.dev/serving/pkg/metrics"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 )
@@ -122,6 +126,24 @@ type breaker interface {
 	Reserve(ctx context.Context) (func(), bool)
 }
 
+// trackerSnapshot is the state used on the request path to pick a destination.
+// A snapshot is never modified once published, a new one is swapped in on
+// every update instead, so the request path does not need to synchronize with
+// the update goroutine.
+type trackerSnapshot struct {
+	// All the trackers of the revision, sorted by dest.
+	// This is only read by the debug handler.
+	podTrackers []*podTracker
+
+	// Effective trackers that are assigned to this Activator.
+	// This is a subset of podTrackers.
+	assignedTrackers []*podTracker
+
+	// If we don't have a healthy clusterIPTracker this is set to nil, otherwise
+	// it is the l4dest for this revision's private clusterIP.
+	clusterIPTracker *podTracker
+}
+
 // revisionThrottler is used to throttle requests across the entire revision.
 // We use a breaker across the entire revision as well as individual
 // podTrackers because we need to queue requests in case no individual
@@ -131,6 +153,11 @@ type revisionThrottler struct {
 	containerConcurrency int
 	lbPolicy             lbPolicy
 
+	// decisionCtxs are the contexts used to record the load balancing
+	// decisions, indexed by reason, so that the request path does not
+	// allocate tag maps. They are set up by setReporterContext.
+	decisionCtxs [numLBReasons]context.Context
+
 	// These are used in slicing to infer which pods to assign
 	// to this activator.
 	numActivators atomic.Int32
@@ -149,19 +176,15 @@ type revisionThrottler struct {
 	breaker breaker
 
 	// This will be non-empty when we're able to use pod addressing.
+	// podTrackers is sorted by dest and is only accessed by the update goroutine.
 	podTrackers []*podTracker
 
-	// Effective trackers that are assigned to this Activator.
-	// This is a subset of podTrackers.
-	assignedTrackers []*podTracker
-
-	// If we don't have a healthy clusterIPTracker this is set to nil, otherwise
-	// it is the l4dest for this revision's private clusterIP.
+	// clusterIPTracker is the latest clusterIP dest, if any.
+	// It is only accessed by the update goroutine.
 	clusterIPTracker *podTracker
 
-	// mux guards the "throttler state" which is the state we use during the
-	// request path. This is: trackers, clusterIPDest.
-	mux sync.RWMutex
+	// trackers holds the *trackerSnapshot currently used on the request path.
+	trackers atomic.Value
 
 	logger *zap.SugaredLogger
 }
@@ -188,7 +211,7 @@ func newRevisionThrottler(revID types.NamespacedName,
 		revBreaker = queue.NewBreaker(breakerParams)
 		lbp = newRoundRobinPolicy()
 	}
-	return &revisionThrottler{
+	rt := &revisionThrottler{
 		revID:                revID,
 		containerConcurrency: containerConcurrency,
 		breaker:              revBreaker,
@@ -197,6 +220,22 @@ func newRevisionThrottler(revID types.NamespacedName,
 		activatorIndex:       *atomic.NewInt32(-1), // Start with unknown.
 		lbPolicy:             lbp,
 	}
+	rt.setReporterContext(context.Background())
+	rt.trackers.Store(&trackerSnapshot{})
+	return rt
+}
+
+// setReporterContext derives the load balancing decision contexts from the
+// revision's reporter context.
+func (rt *revisionThrottler) setReporterContext(ctx context.Context) {
+	for r := range rt.decisionCtxs {
+		rt.decisionCtxs[r], _ = tag.New(ctx, tag.Upsert(reasonKey, lbReason(r).String()))
+	}
+}
+
+// snapshot returns the trackers currently used on the request path.
+func (rt *revisionThrottler) snapshot() *trackerSnapshot {
+	return rt.trackers.Load().(*trackerSnapshot)
 }
 
 func noop() {}
@@ -204,13 +243,14 @@ func noop() {}
 // Returns a dest that at the moment of choosing had an open slot
 // for request.
 func (rt *revisionThrottler) acquireDest(ctx context.Context) (func(), *podTracker) {
-	rt.mux.RLock()
-	defer rt.mux.RUnlock()
-
-	if rt.clusterIPTracker != nil {
-		return noop, rt.clusterIPTracker
+	s := rt.snapshot()
+	if s.clusterIPTracker != nil {
+		pkgmetrics.Record(rt.decisionCtxs[lbReasonClusterIP], lbDecisionCountM.M(1))
+		return noop, s.clusterIPTracker
 	}
-	return rt.lbPolicy(ctx, rt.assignedTrackers)
+	cb, tracker, reason := rt.lbPolicy(ctx, s.assignedTrackers)
+	pkgmetrics.Record(rt.decisionCtxs[reason], lbDecisionCountM.M(1))
+	return cb, tracker
 }
 
 func (rt *revisionThrottler) try(ctx context.Context, function func(string) error) error {
@@ -278,30 +318,27 @@ func (rt *revisionThrottler) updateCapacity(backendCount int) {
 	// of activators changes, then we need to rebalance the assignedTrackers.
 	ac, ai := int(rt.numActivators.Load()), int(rt.activatorIndex.Load())
 	numTrackers := func() int {
-		// We do not have to process the `podTrackers` under lock, since
-		// updateCapacity is guaranteed to be executed by a single goroutine.
-		// But `assignedTrackers` is being read by the serving thread, so the
-		// actual assignment has to be done under lock.
-
 		// We're using cluster IP.
 		if rt.clusterIPTracker != nil {
+			rt.trackers.Store(&trackerSnapshot{
+				podTrackers:      rt.podTrackers,
+				clusterIPTracker: rt.clusterIPTracker,
+			})
 			return 0
 		}
 
-		// Sort, so we get more or less stable results.
-		sort.Slice(rt.podTrackers, func(i, j int) bool {
-			return rt.podTrackers[i].dest < rt.podTrackers[j].dest
-		})
+		// The published snapshot may alias `podTrackers`, so neither the
+		// slice nor its order may be changed from here on.
 		assigned := rt.podTrackers
 		if rt.containerConcurrency > 0 {
 			rt.resetTrackers()
 			assigned = assignSlice(rt.podTrackers, ai, ac, rt.containerConcurrency)
 		}
 		rt.logger.Debugf("Trackers %d/%d: assignment: %v", ai, ac, assigned)
-		// The actual write out of the assigned trackers has to be under lock.
-		rt.mux.Lock()
-		defer rt.mux.Unlock()
-		rt.assignedTrackers = assigned
+		rt.trackers.Store(&trackerSnapshot{
+			podTrackers:      rt.podTrackers,
+			assignedTrackers: assigned,
+		})
 		return len(assigned)
 	}()
 
@@ -326,16 +363,17 @@ func (rt *revisionThrottler) updateThrottlerState(backendCount int, trackers []*
 	rt.logger.Infof("Updating Revision Throttler with: clusterIP = %v, trackers = %d, backends = %d",
 		clusterIPDest, len(trackers), backendCount)
 
-	// Update trackers / clusterIP before capacity. Otherwise we can race updating our breaker when
-	// we increase capacity, causing a request to fall through before a tracker is added, causing an
-	// incorrect LB decision.
-	if func() bool {
-		rt.mux.Lock()
-		defer rt.mux.Unlock()
-		rt.podTrackers = trackers
-		rt.clusterIPTracker = clusterIPDest
-		return clusterIPDest != nil || len(trackers) > 0
-	}() {
+	// Sort, so we get more or less stable results.
+	sort.Slice(trackers, func(i, j int) bool {
+		return trackers[i].dest < trackers[j].dest
+	})
+	rt.podTrackers = trackers
+	rt.clusterIPTracker = clusterIPDest
+
+	// updateCapacity publishes the trackers / clusterIP before updating the capacity. Otherwise we
+	// can race updating our breaker when we increase capacity, causing a request to fall through
+	// before a tracker is added, causing an incorrect LB decision.
+	if clusterIPDest != nil || len(trackers) > 0 {
 		// If we have an address to target, then pass through an accurate
 		// accounting of the number of backends.
 		rt.updateCapacity(backendCount)
@@ -385,7 +423,8 @@ func assignSlice(trackers []*podTracker, selfIndex, numActivators, cc int) []*po
 	bi, ei, remnants := pickIndices(lt, selfIndex, numActivators)
 	x := append(trackers[:0:0], trackers[bi:ei]...)
 	if remnants > 0 {
-		tail := trackers[len(trackers)-remnants:]
+		// Copy the tail, since `trackers` must not be modified.
+		tail := append(trackers[:0:0], trackers[len(trackers)-remnants:]...)
 		// We shuffle the tail, to ensure that pods in the tail get better
 		// load distribution, since we sort the pods above, this puts more requests
 		// on the very first tail pod, than on the others.
@@ -404,15 +443,16 @@ func assignSlice(trackers []*podTracker, selfIndex, numActivators, cc int) []*po
 	return x
 }
 
-// This function will never be called in parallel but `try` can be called in parallel to this so we need
-// to lock on updating concurrency / trackers
+// This function will never be called in parallel, but `try` can be called in parallel to this.
+// `podTrackers` is only ever accessed from here, while the request path only reads the
+// published trackerSnapshot, which updateCapacity swaps in as a whole.
 func (rt *revisionThrottler) handleUpdate(update revisionDestsUpdate) {
 	rt.logger.Debugw("Handling update",
 		zap.String("ClusterIP", update.ClusterIPDest), zap.Object("dests", logging.StringSet(update.Dests)))
 
 	// ClusterIP is not yet ready, so we want to send requests directly to the pods.
 	// NB: this will not be called in parallel, thus we can build a new podTrackers
-	// array before taking out a lock.
+	// array and read the current one without synchronization.
 	if update.ClusterIPDest == "" {
 		// Create a map for fast lookup of existing trackers.
 		trackersMap := make(map[string]*podTracker, len(rt.podTrackers))
@@ -453,17 +493,19 @@ type Throttler struct {
 	revisionThrottlers      map[types.NamespacedName]*revisionThrottler
 	revisionThrottlersMutex sync.RWMutex
 	revisionLister          servinglisters.RevisionLister
+	podName                 string // The name of this activator pod.
 	ipAddress               string // The IP address of this activator.
 	logger                  *zap.SugaredLogger
 	epsUpdateCh             chan *corev1.Endpoints
 }
 
 // NewThrottler creates a new Throttler
-func NewThrottler(ctx context.Context, ipAddr string) *Throttler {
+func NewThrottler(ctx context.Context, podName, ipAddr string) *Throttler {
 	revisionInformer := revisioninformer.Get(ctx)
 	t := &Throttler{
 		revisionThrottlers: make(map[types.NamespacedName]*revisionThrottler),
 		revisionLister:     revisionInformer.Lister(),
+		podName:            podName,
 		ipAddress:          ipAddr,
 		logger:             logging.FromContext(ctx),
 		epsUpdateCh:        make(chan *corev1.Endpoints),
@@ -549,6 +591,9 @@ func (t *Throttler) getOrCreateRevisionThrottler(revID types.NamespacedName) (*r
 			queue.BreakerParams{QueueDepth: breakerQueueDepth, MaxConcurrency: revisionMaxConcurrency},
 			t.logger,
 		)
+		reporterCtx, _ := metrics.PodRevisionContext(t.podName, activator.Name, revID.Namespace,
+			rev.Labels[serving.ServiceLabelKey], rev.Labels[serving.ConfigurationLabelKey], revID.Name)
+		revThrottler.setReporterContext(reporterCtx)
 		t.revisionThrottlers[revID] = revThrottler
 	}
 	return revThrottler, nil
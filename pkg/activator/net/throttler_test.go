@@ -27,6 +27,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/resource"
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,12 +39,16 @@ import (
 	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	fakeendpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints/fake"
 	. "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/metrics/metricstest"
+	_ "knative.dev/pkg/metrics/testing"
 	rtesting "knative.dev/pkg/reconciler/testing"
+	"knative.dev/serving/pkg/activator"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	fakeservingclient "knative.dev/serving/pkg/client/injection/client/fake"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
 	fakerevisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision/fake"
+	"knative.dev/serving/pkg/metrics"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
 )
@@ -59,8 +64,10 @@ type tryResult struct {
 	err  error
 }
 
+const testActivatorPod = "the-best-activator"
+
 func newTestThrottler(ctx context.Context) *Throttler {
-	return NewThrottler(ctx, "10.10.10.10")
+	return NewThrottler(ctx, testActivatorPod, "10.10.10.10")
 }
 
 func TestThrottlerUpdateCapacity(t *testing.T) {
@@ -186,9 +193,9 @@ func TestThrottlerUpdateCapacity(t *testing.T) {
 	if got, want := rt.breaker.Capacity(), 1; got != want {
 		t.Errorf("Capacity = %d, want: %d", got, want)
 	}
-	if got, want := len(rt.assignedTrackers), len(rt.podTrackers); got != want {
+	if got, want := len(rt.snapshot().assignedTrackers), len(rt.podTrackers); got != want {
 		t.Errorf("Assigned tracker count = %d, want: %d, diff:\n%s", got, want,
-			cmp.Diff(rt.assignedTrackers, rt.podTrackers))
+			cmp.Diff(rt.snapshot().assignedTrackers, rt.podTrackers))
 	}
 }
 
@@ -427,7 +434,7 @@ func TestThrottlerSuccesses(t *testing.T) {
 
 			updateCh := make(chan revisionDestsUpdate)
 
-			throttler := NewThrottler(ctx, "130.0.0.2")
+			throttler := NewThrottler(ctx, testActivatorPod, "130.0.0.2")
 			var grp errgroup.Group
 			grp.Go(func() error { throttler.run(updateCh); return nil })
 			// Ensure the throttler stopped before we leave the test, so that
@@ -475,15 +482,13 @@ func TestThrottlerSuccesses(t *testing.T) {
 				wantCapacity = dests * int(*cc)
 			}
 			if err := wait.PollImmediate(10*time.Millisecond, 3*time.Second, func() (bool, error) {
-				rt.mux.RLock()
-				defer rt.mux.RUnlock()
 				if *cc != 0 {
 					return rt.activatorIndex.Load() != -1 && rt.breaker.Capacity() == wantCapacity &&
-						sortedTrackers(rt.assignedTrackers), nil
+						sortedTrackers(rt.snapshot().assignedTrackers), nil
 				}
 				// If CC=0 then verify number of backends, rather the capacity of breaker.
-				return rt.activatorIndex.Load() != -1 && dests == len(rt.assignedTrackers) &&
-					sortedTrackers(rt.assignedTrackers), nil
+				return rt.activatorIndex.Load() != -1 && dests == len(rt.snapshot().assignedTrackers) &&
+					sortedTrackers(rt.snapshot().assignedTrackers), nil
 			}); err != nil {
 				t.Fatal("Timed out waiting for the capacity to be updated")
 			}
@@ -509,10 +514,8 @@ func TestThrottlerSuccesses(t *testing.T) {
 
 			if got, want := gotDests.List(), tc.wantDests.List(); !cmp.Equal(want, got) {
 				t.Errorf("Dests = %v, want: %v, diff: %s", got, want, cmp.Diff(want, got))
-				rt.mux.RLock()
-				defer rt.mux.RUnlock()
 				t.Log("podTrackers:\n", spew.Sdump(rt.podTrackers))
-				t.Log("assignedTrackers:\n", spew.Sdump(rt.assignedTrackers))
+				t.Log("assignedTrackers:\n", spew.Sdump(rt.snapshot().assignedTrackers))
 			}
 		})
 	}
@@ -552,19 +555,19 @@ func TestPodAssignmentFinite(t *testing.T) {
 	if got, want := len(rt.podTrackers), len(update.Dests); got != want {
 		t.Errorf("NumTrackers = %d, want: %d", got, want)
 	}
-	if got, want := trackerDestSet(rt.assignedTrackers), sets.NewString("ip0", "ip4", "ip5"); !got.Equal(want) {
+	if got, want := trackerDestSet(rt.snapshot().assignedTrackers), sets.NewString("ip0", "ip4", "ip5"); !got.Equal(want) {
 		t.Errorf("Assigned trackers = %v, want: %v, diff: %s", got, want, cmp.Diff(want, got))
 	}
 	if got, want := rt.breaker.Capacity(), 6*42/4; got != want {
 		t.Errorf("TotalCapacity = %d, want: %d", got, want)
 	}
-	if got, want := rt.assignedTrackers[0].Capacity(), 42; got != want {
+	if got, want := rt.snapshot().assignedTrackers[0].Capacity(), 42; got != want {
 		t.Errorf("Exclusive tracker capacity: %d, want: %d", got, want)
 	}
-	if got, want := rt.assignedTrackers[1].Capacity(), int(math.Ceil(42./4.)); got != want {
+	if got, want := rt.snapshot().assignedTrackers[1].Capacity(), int(math.Ceil(42./4.)); got != want {
 		t.Errorf("Shared tracker capacity: %d, want: %d", got, want)
 	}
-	if got, want := rt.assignedTrackers[2].Capacity(), int(math.Ceil(42./4.)); got != want {
+	if got, want := rt.snapshot().assignedTrackers[2].Capacity(), int(math.Ceil(42./4.)); got != want {
 		t.Errorf("Shared tracker capacity: %d, want: %d", got, want)
 	}
 
@@ -574,7 +577,7 @@ func TestPodAssignmentFinite(t *testing.T) {
 	if got, want := len(rt.podTrackers), 0; got != want {
 		t.Errorf("NumTrackers = %d, want: %d", got, want)
 	}
-	if got, want := len(rt.assignedTrackers), 0; got != want {
+	if got, want := len(rt.snapshot().assignedTrackers), 0; got != want {
 		t.Errorf("NumAssignedTrackers = %d, want: %d", got, want)
 	}
 	if got, want := rt.breaker.Capacity(), 0; got != want {
@@ -604,13 +607,13 @@ func TestPodAssignmentInfinite(t *testing.T) {
 	if got, want := len(rt.podTrackers), 3; got != want {
 		t.Errorf("NumTrackers = %d, want: %d", got, want)
 	}
-	if got, want := len(rt.assignedTrackers), 3; got != want {
+	if got, want := len(rt.snapshot().assignedTrackers), 3; got != want {
 		t.Errorf("NumAssigned trackers = %d, want: %d", got, want)
 	}
 	if got, want := rt.breaker.Capacity(), 1; got != want {
 		t.Errorf("TotalCapacity = %d, want: %d", got, want)
 	}
-	if got, want := rt.assignedTrackers[0].Capacity(), 1; got != want {
+	if got, want := rt.snapshot().assignedTrackers[0].Capacity(), 1; got != want {
 		t.Errorf("Exclusive tracker capacity: %d, want: %d", got, want)
 	}
 
@@ -620,7 +623,7 @@ func TestPodAssignmentInfinite(t *testing.T) {
 	if got, want := len(rt.podTrackers), 0; got != want {
 		t.Errorf("NumTrackers = %d, want: %d", got, want)
 	}
-	if got, want := len(rt.assignedTrackers), 0; got != want {
+	if got, want := len(rt.snapshot().assignedTrackers), 0; got != want {
 		t.Errorf("NumAssignedTrackers = %d, want: %d", got, want)
 	}
 	if got, want := rt.breaker.Capacity(), 0; got != want {
@@ -649,7 +652,7 @@ func TestActivatorsIndexUpdate(t *testing.T) {
 
 	updateCh := make(chan revisionDestsUpdate)
 
-	throttler := NewThrottler(ctx, "130.0.0.2")
+	throttler := NewThrottler(ctx, testActivatorPod, "130.0.0.2")
 	var grp errgroup.Group
 	grp.Go(func() error { throttler.run(updateCh); return nil })
 	// Ensure the throttler stopped before we leave the test, so that
@@ -704,7 +707,7 @@ func TestActivatorsIndexUpdate(t *testing.T) {
 	if got, want := rt.activatorIndex.Load(), int32(1); got != want {
 		t.Fatalf("activatorIndex = %d, want %d", got, want)
 	}
-	if got, want := len(rt.assignedTrackers), 2; got != want {
+	if got, want := len(rt.snapshot().assignedTrackers), 2; got != want {
 		t.Fatalf("len(assignedTrackers) = %d, want %d", got, want)
 	}
 
@@ -744,7 +747,7 @@ func TestMultipleActivators(t *testing.T) {
 
 	updateCh := make(chan revisionDestsUpdate)
 
-	throttler := NewThrottler(ctx, "130.0.0.2")
+	throttler := NewThrottler(ctx, testActivatorPod, "130.0.0.2")
 	var grp errgroup.Group
 	grp.Go(func() error { throttler.run(updateCh); return nil })
 	// Ensure the throttler stopped before we leave the test, so that
@@ -1157,4 +1160,157 @@ func TestAssignSlice(t *testing.T) {
 			t.Errorf("Capacity for the tail pod = %d, want: %d", got, want)
 		}
 	})
+	t.Run("input is not modified", func(t *testing.T) {
+		trackers := []*podTracker{{
+			dest: "1",
+			b:    queue.NewBreaker(testBreakerParams),
+		}, {
+			dest: "2",
+			b:    queue.NewBreaker(testBreakerParams),
+		}, {
+			dest: "3",
+			b:    queue.NewBreaker(testBreakerParams),
+		}, {
+			dest: "4",
+			b:    queue.NewBreaker(testBreakerParams),
+		}, {
+			dest: "5",
+			b:    queue.NewBreaker(testBreakerParams),
+		}}
+		cp := append(trackers[:0:0], trackers...)
+		// The two remnants are shuffled on every call, so make sure
+		// that happens on a copy.
+		for i := 0; i < 20; i++ {
+			assignSlice(cp, 0, 3, 6)
+			if !cmp.Equal(cp, trackers, opt) {
+				t.Fatalf("Input = %v, want: %v; diff: %s", cp, trackers,
+					cmp.Diff(trackers, cp, opt))
+			}
+		}
+	})
+}
+
+func TestRoundRobinPerRevision(t *testing.T) {
+	logger := TestLogger(t)
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	defer cancel()
+
+	throttler := newTestThrottler(ctx)
+	revs := []types.NamespacedName{
+		{Namespace: testNamespace, Name: "rr-1"},
+		{Namespace: testNamespace, Name: "rr-2"},
+	}
+	for _, rev := range revs {
+		rt := newRevisionThrottler(rev, 10 /*cc*/, pkgnet.ServicePortNameHTTP1, testBreakerParams, logger)
+		rt.numActivators.Store(1)
+		rt.activatorIndex.Store(0)
+		throttler.revisionThrottlers[rev] = rt
+		throttler.handleUpdate(revisionDestsUpdate{
+			Rev:   rev,
+			Dests: sets.NewString("ip1", "ip2", "ip3"),
+		})
+	}
+
+	// Interleaving the revisions must not skew either one's rotation.
+	for _, want := range []string{"ip1", "ip2", "ip3", "ip1"} {
+		for _, rev := range revs {
+			cb, tracker := throttler.revisionThrottlers[rev].acquireDest(context.Background())
+			if tracker == nil {
+				t.Fatalf("%s: acquireDest() = nil, want: %s", rev, want)
+			}
+			cb()
+			if got := tracker.dest; got != want {
+				t.Errorf("%s: dest = %s, want: %s", rev, got, want)
+			}
+		}
+	}
+}
+
+func TestThrottlerLBDecisionMetric(t *testing.T) {
+	resetMetrics()
+	defer resetMetrics()
+
+	ctx, cancel, _ := rtesting.SetupFakeContextWithCancel(t)
+	revisions := fakerevisioninformer.Get(ctx)
+	waitInformers, err := rtesting.RunAndSyncInformers(ctx, revisions.Informer())
+	if err != nil {
+		t.Fatal("Failed to start informers:", err)
+	}
+	defer func() {
+		cancel()
+		waitInformers()
+	}()
+
+	// The metrics reporting contexts are cached by revision, so use a revision
+	// no other test uses.
+	revID := types.NamespacedName{Namespace: testNamespace, Name: "lb-decision-revision"}
+	revisions.Informer().GetIndexer().Add(revision(revID, pkgnet.ProtocolHTTP1, 1, func(r *v1.Revision) {
+		r.Labels = map[string]string{
+			serving.ServiceLabelKey:       "test-service",
+			serving.ConfigurationLabelKey: "test-config",
+		}
+	}))
+
+	wantResource := &resource.Resource{
+		Type: metrics.ResourceTypeKnativeRevision,
+		Labels: map[string]string{
+			metrics.LabelNamespaceName:     testNamespace,
+			metrics.LabelServiceName:       "test-service",
+			metrics.LabelConfigurationName: "test-config",
+			metrics.LabelRevisionName:      revID.Name,
+		},
+	}
+
+	throttler := newTestThrottler(ctx)
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:   revID,
+		Dests: sets.NewString("128.0.0.1:1234"),
+	})
+	if err := throttler.Try(ctx, revID, func(string) error { return nil }); err != nil {
+		t.Fatal("Try() =", err)
+	}
+	metricstest.AssertMetric(t, metricstest.IntMetric(lbDecisionCountM.Name(), 1,
+		lbDecisionTags(lbReasonFirstAvailable)).WithResource(wantResource))
+
+	// With the first pod full, the policy has to move on to the second one.
+	resetMetrics()
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:   revID,
+		Dests: sets.NewString("128.0.0.1:1234", "128.0.0.2:1234"),
+	})
+	release, ok := throttler.revisionThrottlers[revID].snapshot().assignedTrackers[0].Reserve(ctx)
+	if !ok {
+		t.Fatal("Failed to reserve the first pod")
+	}
+	if err := throttler.Try(ctx, revID, func(string) error { return nil }); err != nil {
+		t.Fatal("Try() =", err)
+	}
+	release()
+	metricstest.AssertMetric(t, metricstest.IntMetric(lbDecisionCountM.Name(), 1,
+		lbDecisionTags(lbReasonFirstAvailableOverflow)).WithResource(wantResource))
+
+	resetMetrics()
+	throttler.handleUpdate(revisionDestsUpdate{
+		Rev:           revID,
+		ClusterIPDest: "129.0.0.1:1234",
+		Dests:         sets.NewString("128.0.0.1:1234"),
+	})
+	if err := throttler.Try(ctx, revID, func(string) error { return nil }); err != nil {
+		t.Fatal("Try() =", err)
+	}
+	metricstest.AssertMetric(t, metricstest.IntMetric(lbDecisionCountM.Name(), 1,
+		lbDecisionTags(lbReasonClusterIP)).WithResource(wantResource))
+}
+
+func lbDecisionTags(reason lbReason) map[string]string {
+	return map[string]string{
+		metrics.LabelPodName:       testActivatorPod,
+		metrics.LabelContainerName: activator.Name,
+		"reason":                   reason.String(),
+	}
+}
+
+func resetMetrics() {
+	metricstest.Unregister(lbDecisionCountM.Name())
+	register()
 }